@@ -0,0 +1,99 @@
+package utili
+
+import (
+	"html/template"
+	"sync"
+	"time"
+)
+
+// TemplateCache holds parsed templates across calls to CopyDir2, so that copying the
+// same tree many times (for example in table-driven tests) parses each template only
+// once. File contents are keyed by absolute path, modification time and size, so an
+// edited file is parsed again. A TemplateCache is safe for concurrent use.
+//
+// Entries are never evicted: the cache grows with each distinct file and file name
+// seen, until Reset is called.
+//
+// Pass it to CopyDir2 with WithTemplateCache.
+type TemplateCache struct {
+	mu    sync.Mutex
+	files map[fileKey]*template.Template
+	names map[string]*template.Template
+}
+
+type fileKey struct {
+	path    string
+	modTime time.Time
+	size    int64
+	// The template source went through markActionLines.
+	actionLines bool
+}
+
+// NewTemplateCache returns an empty TemplateCache.
+func NewTemplateCache() *TemplateCache {
+	return &TemplateCache{
+		files: map[fileKey]*template.Template{},
+		names: map[string]*template.Template{},
+	}
+}
+
+// Reset removes all entries from the cache.
+func (c *TemplateCache) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.files = map[fileKey]*template.Template{}
+	c.names = map[string]*template.Template{}
+}
+
+// WithTemplateCache makes CopyDir2 look up and store parsed templates in `cache`.
+func WithTemplateCache(cache *TemplateCache) Option {
+	return func(cfg *copyConfig) { cfg.cache = cache }
+}
+
+// fileTemplate returns the parsed template for the file identified by `key`, calling
+// `parse` on a cache miss. A nil cache always calls `parse`.
+func (c *TemplateCache) fileTemplate(
+	key fileKey,
+	parse func() (*template.Template, error),
+) (*template.Template, error) {
+	if c == nil {
+		return parse()
+	}
+	return lookup(&c.mu, c.files, key, parse)
+}
+
+// nameTemplate returns the parsed template for the file name `name`, calling `parse`
+// on a cache miss. A nil cache always calls `parse`.
+func (c *TemplateCache) nameTemplate(
+	name string,
+	parse func() (*template.Template, error),
+) (*template.Template, error) {
+	if c == nil {
+		return parse()
+	}
+	return lookup(&c.mu, c.names, name, parse)
+}
+
+// lookup returns m[key], storing there the result of `parse` on a miss. Parse errors
+// are not cached. The lock is not held while parsing.
+func lookup[K comparable](
+	mu *sync.Mutex,
+	m map[K]*template.Template,
+	key K,
+	parse func() (*template.Template, error),
+) (*template.Template, error) {
+	mu.Lock()
+	tmpl, ok := m[key]
+	mu.Unlock()
+	if ok {
+		return tmpl, nil
+	}
+	tmpl, err := parse()
+	if err != nil {
+		return nil, err
+	}
+	mu.Lock()
+	m[key] = tmpl
+	mu.Unlock()
+	return tmpl, nil
+}
@@ -0,0 +1,158 @@
+package utili
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTemplateCache(t *testing.T) {
+	testCases := []struct {
+		name string
+		// Called between the two copies, on the template file.
+		change  func(t *testing.T, path string)
+		wantHit bool
+	}{
+		{
+			name: "same mtime and size is a hit",
+			change: func(t *testing.T, path string) {
+				// Different contents, same size and mtime: only a cache hit renders
+				// the old contents.
+				fi, err := os.Stat(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				writeFile(t, path, "v9 {{.x}}")
+				if err := os.Chtimes(path, fi.ModTime(), fi.ModTime()); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantHit: true,
+		},
+		{
+			name: "mtime change is a miss",
+			change: func(t *testing.T, path string) {
+				// Same size, different contents and mtime.
+				writeFile(t, path, "v2 {{.x}}")
+				future := time.Now().Add(time.Hour)
+				if err := os.Chtimes(path, future, future); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantHit: false,
+		},
+		{
+			name: "size change is a miss",
+			change: func(t *testing.T, path string) {
+				// Same mtime, different size.
+				fi, err := os.Stat(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				writeFile(t, path, "v2 longer {{.x}}")
+				if err := os.Chtimes(path, fi.ModTime(), fi.ModTime()); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantHit: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			src := filepath.Join(t.TempDir(), "src")
+			writeTree(t, src, map[string]string{"f.template": "v1 {{.x}}"})
+			cache := NewTemplateCache()
+			data := TemplateData{"x": "a"}
+			if err := CopyDir2(src, t.TempDir(), IdentityRename, data,
+				WithTemplateCache(cache)); err != nil {
+				t.Fatal(err)
+			}
+
+			tc.change(t, filepath.Join(src, "f.template"))
+			dst := t.TempDir()
+			if err := CopyDir2(src, dst, IdentityRename, data,
+				WithTemplateCache(cache)); err != nil {
+				t.Fatal(err)
+			}
+
+			have := readFile(t, filepath.Join(dst, "src", "f"))
+			want := "v1 a"
+			if !tc.wantHit {
+				want = readFile(t, filepath.Join(src, "f.template"))
+				want = want[:len(want)-len("{{.x}}")] + "a"
+			}
+			if have != want {
+				t.Errorf("have: %q; want: %q", have, want)
+			}
+			if have, want := len(cache.files), 1; tc.wantHit && have != want {
+				t.Errorf("cached files: have %d; want %d", have, want)
+			}
+		})
+	}
+}
+
+func TestTemplateCacheReset(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "src")
+	writeTree(t, src, map[string]string{"f.template": "{{.x}}"})
+	cache := NewTemplateCache()
+	if err := CopyDir2(src, t.TempDir(), IdentityRename, TemplateData{"x": "a"},
+		WithTemplateCache(cache)); err != nil {
+		t.Fatal(err)
+	}
+	if len(cache.files) != 1 || len(cache.names) != 1 {
+		t.Fatalf("before reset: have %d files, %d names; want 1, 1",
+			len(cache.files), len(cache.names))
+	}
+
+	cache.Reset()
+
+	if len(cache.files) != 0 || len(cache.names) != 0 {
+		t.Errorf("after reset: have %d files, %d names; want 0, 0",
+			len(cache.files), len(cache.names))
+	}
+}
+
+func TestTemplateCacheKeyIsAbsolutePath(t *testing.T) {
+	cache := NewTemplateCache()
+	data := TemplateData{"x": "a"}
+	mtime := time.Now().Add(-time.Hour)
+	for _, text := range []string{"one {{.x}}", "two {{.x}}"} {
+		// Same relative path, size and mtime; different directory.
+		dir := t.TempDir()
+		writeTree(t, dir, map[string]string{"src/f.template": text})
+		path := filepath.Join(dir, "src", "f.template")
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+		Chdir(t, dir)
+		dst := t.TempDir()
+
+		if err := CopyDir2("src", dst, IdentityRename, data,
+			WithTemplateCache(cache)); err != nil {
+			t.Fatal(err)
+		}
+
+		have := readFile(t, filepath.Join(dst, "src", "f"))
+		if want := text[:4] + "a"; have != want {
+			t.Errorf("have: %q; want: %q", have, want)
+		}
+	}
+}
+
+func writeFile(t *testing.T, path string, contents string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(contents), 0660); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(buf)
+}
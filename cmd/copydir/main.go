@@ -24,6 +24,12 @@ Generic options:
 Options:
   --dot         rename each dot.something to .something
 
+Template options:
+  --trim-space    trim trailing spaces and tabs of each line
+  --final-nl      end each file with exactly one newline
+  --collapse      collapse runs of blank lines into one
+  --trim-actions  remove the lines holding only actions such as {{if}}
+
 Arguments
   <keyvals>     is of the form k1=v1 k2=v2 ... and enables Go template processing
 `
@@ -36,11 +42,15 @@ func main() {
 }
 
 type config struct {
-	Verbose bool
-	Dot     bool
-	SrcDir  string   `docopt:"<srcdir>"`
-	DstDir  string   `docopt:"<dstdir>"`
-	KeyVals []string `docopt:"<keyvals>"`
+	Verbose  bool
+	Dot      bool
+	Trim     bool `docopt:"--trim-space"`
+	FinalNL  bool `docopt:"--final-nl"`
+	Collapse bool
+	TrimActs bool     `docopt:"--trim-actions"`
+	SrcDir   string   `docopt:"<srcdir>"`
+	DstDir   string   `docopt:"<dstdir>"`
+	KeyVals  []string `docopt:"<keyvals>"`
 	//
 }
 
@@ -68,7 +78,21 @@ func run(args []string) error {
 		rename = utili.DotRename
 	}
 
-	if err := utili.CopyDir2(app.SrcDir, app.DstDir, rename, tmplData); err != nil {
+	var copyOpts []utili.Option
+	if app.Trim {
+		copyOpts = append(copyOpts, utili.TrimTrailingSpace())
+	}
+	if app.FinalNL {
+		copyOpts = append(copyOpts, utili.SingleTrailingNewline())
+	}
+	if app.Collapse {
+		copyOpts = append(copyOpts, utili.CollapseBlankLines())
+	}
+	if app.TrimActs {
+		copyOpts = append(copyOpts, utili.TrimActionLines())
+	}
+
+	if err := utili.CopyDir2(app.SrcDir, app.DstDir, rename, tmplData, copyOpts...); err != nil {
 		return err
 	}
 
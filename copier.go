@@ -0,0 +1,59 @@
+package utili
+
+// Copier copies directory trees like CopyDir2, with a configuration prepared once and
+// reused for each copy. It keeps a TemplateCache, so repeated copies of the same tree
+// parse each template only once.
+//
+// Useful for scaffolding code and table-driven tests:
+//
+//	copier := utili.NewCopier(utili.DotRename, utili.TemplateData{"branch": "main"},
+//	    utili.SingleTrailingNewline())
+//	for _, tc := range testCases {
+//	    err := copier.Copy("testdata/repo", t.TempDir(), tc.data)
+//	    ...
+//	}
+//
+// A Copier is safe for concurrent use.
+type Copier struct {
+	rename RenameFn
+	data   TemplateData
+	cfg    *copyConfig
+}
+
+// NewCopier returns a Copier that renames directories with `rename` and fills the
+// templates with `defaults`, configured by `opts`. A nil `rename` means
+// IdentityRename. If `opts` does not contain
+// WithTemplateCache, the Copier uses a private TemplateCache.
+func NewCopier(rename RenameFn, defaults TemplateData, opts ...Option) *Copier {
+	if rename == nil {
+		rename = IdentityRename
+	}
+	cfg := newCopyConfig(opts)
+	if cfg.cache == nil {
+		cfg.cache = NewTemplateCache()
+	}
+	return &Copier{
+		rename: rename,
+		data:   mergeData(defaults, nil),
+		cfg:    cfg,
+	}
+}
+
+// Copy copies `src` below `dst` as CopyDir2 does. The template data is the Copier
+// defaults overridden by `extraData`, which can be nil.
+func (c *Copier) Copy(src, dst string, extraData TemplateData) error {
+	return copyDir(src, dst, c.rename, mergeData(c.data, extraData), c.cfg, "")
+}
+
+// mergeData returns a new TemplateData with the keys of `base` and `override`, the
+// latter taking precedence.
+func mergeData(base, override TemplateData) TemplateData {
+	data := make(TemplateData, len(base)+len(override))
+	for k, v := range base {
+		data[k] = v
+	}
+	for k, v := range override {
+		data[k] = v
+	}
+	return data
+}
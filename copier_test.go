@@ -0,0 +1,137 @@
+package utili
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestWithFilter(t *testing.T) {
+	testCases := []struct {
+		name    string
+		filters []FilterFn
+		want    []string
+	}{
+		{
+			name: "no filters",
+			want: []string{"a", "skip.txt", "sub", "sub/b", "sub/skip.txt"},
+		},
+		{
+			name: "skip files",
+			filters: []FilterFn{func(path string, fi os.FileInfo) bool {
+				return !strings.HasPrefix(fi.Name(), "skip")
+			}},
+			want: []string{"a", "sub", "sub/b"},
+		},
+		{
+			name: "skip directory",
+			filters: []FilterFn{func(path string, fi os.FileInfo) bool {
+				return !(fi.IsDir() && fi.Name() == "sub")
+			}},
+			want: []string{"a", "skip.txt"},
+		},
+		{
+			name: "skip by relative path",
+			filters: []FilterFn{func(path string, fi os.FileInfo) bool {
+				return path != "sub/skip.txt"
+			}},
+			want: []string{"a", "skip.txt", "sub", "sub/b"},
+		},
+		{
+			name: "all filters must accept",
+			filters: []FilterFn{
+				func(path string, fi os.FileInfo) bool { return fi.Name() != "a" },
+				func(path string, fi os.FileInfo) bool { return fi.Name() != "skip.txt" },
+			},
+			want: []string{"sub", "sub/b"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			src := filepath.Join(t.TempDir(), "src")
+			writeTree(t, src, map[string]string{
+				"a":            "",
+				"skip.txt":     "",
+				"sub/b":        "",
+				"sub/skip.txt": "",
+			})
+			dst := t.TempDir()
+			var opts []Option
+			for _, filter := range tc.filters {
+				opts = append(opts, WithFilter(filter))
+			}
+
+			if err := CopyDir2(src, dst, IdentityRename, nil, opts...); err != nil {
+				t.Fatal(err)
+			}
+
+			have := listPaths(t, filepath.Join(dst, "src"))
+			if strings.Join(have, " ") != strings.Join(tc.want, " ") {
+				t.Errorf("\nhave: %v\nwant: %v", have, tc.want)
+			}
+		})
+	}
+}
+
+func TestCopierMergesData(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "src")
+	writeTree(t, src, map[string]string{"f-{{.name}}.template": "{{.a}} {{.b}}"})
+	defaults := TemplateData{"name": "x", "a": "1", "b": "2"}
+	copier := NewCopier(nil, defaults, SingleTrailingNewline())
+
+	testCases := []struct {
+		name      string
+		extraData TemplateData
+		wantFile  string
+		wantText  string
+	}{
+		{"defaults only", nil, "f-x", "1 2\n"},
+		{"extra data overrides defaults", TemplateData{"b": "3"}, "f-x", "1 3\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dst := t.TempDir()
+
+			if err := copier.Copy(src, dst, tc.extraData); err != nil {
+				t.Fatal(err)
+			}
+
+			have := readFile(t, filepath.Join(dst, "src", tc.wantFile))
+			if have != tc.wantText {
+				t.Errorf("have: %q; want: %q", have, tc.wantText)
+			}
+		})
+	}
+	if have, want := defaults["b"], "2"; have != want {
+		t.Errorf("defaults modified: have b=%q; want %q", have, want)
+	}
+}
+
+// listPaths returns the sorted, slash-separated paths below `dir`.
+func listPaths(t *testing.T, dir string) []string {
+	t.Helper()
+	var paths []string
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == dir {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		paths = append(paths, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(paths)
+	return paths
+}
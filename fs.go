@@ -7,11 +7,11 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
-	"os/exec"
 	"path"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 // Passed to template.Execute()
@@ -70,15 +70,35 @@ func CopyDir(
 	dst string,
 	rename RenameFn,
 	tmplData TemplateData,
+	opts ...Option,
 ) {
 	t.Helper()
 
-	if err := CopyDir2(src, dst, rename, tmplData); err != nil {
+	if err := CopyDir2(src, dst, rename, tmplData, opts...); err != nil {
 		t.Fatal("CopyDir:", err)
 	}
 }
 
-func CopyDir2(src string, dst string, rename RenameFn, tmplData TemplateData) error {
+// CopyDir2 is like CopyDir, but returns an error instead of calling t.Fatal.
+// See Option for the optional arguments.
+func CopyDir2(
+	src string,
+	dst string,
+	rename RenameFn,
+	tmplData TemplateData,
+	opts ...Option,
+) error {
+	return copyDir(src, dst, rename, tmplData, newCopyConfig(opts), "")
+}
+
+func copyDir(
+	src string,
+	dst string,
+	rename RenameFn,
+	tmplData TemplateData,
+	cfg *copyConfig,
+	relDir string,
+) error {
 	for _, dir := range []string{src, dst} {
 		fi, err := os.Stat(dir)
 		if err != nil {
@@ -101,8 +121,12 @@ func CopyDir2(src string, dst string, rename RenameFn, tmplData TemplateData) er
 	}
 	for _, e := range srcEntries {
 		src := filepath.Join(src, e.Name())
+		rel := path.Join(relDir, e.Name())
+		if !cfg.accept(rel, e) {
+			continue
+		}
 		if e.IsDir() {
-			if err := CopyDir2(src, tgtDir, rename, tmplData); err != nil {
+			if err := copyDir(src, tgtDir, rename, tmplData, cfg, rel); err != nil {
 				return err
 			}
 		} else {
@@ -112,19 +136,26 @@ func CopyDir2(src string, dst string, rename RenameFn, tmplData TemplateData) er
 				// doesn't have the .template suffix!
 				name = strings.TrimSuffix(name, ".template")
 				// Subject the file name itself to template expansion
-				tmpl, err := template.New("file-name").Parse(name)
+				tmpl, err := cfg.cache.nameTemplate(name, func() (*template.Template, error) {
+					tmpl, err := template.New("file-name").Parse(name)
+					if err != nil {
+						return nil, err
+					}
+					return tmpl.Option("missingkey=error"), nil
+				})
 				if err != nil {
+					cfg.getMetrics().Add(MetricTemplateFailures, 1)
 					return fmt.Errorf("parsing file name as template %v: %w", src, err)
 				}
-				tmpl.Option("missingkey=error")
 				buf := &bytes.Buffer{}
 				if err := tmpl.Execute(buf, tmplData); err != nil {
+					cfg.getMetrics().Add(MetricTemplateFailures, 1)
 					return fmt.Errorf("executing template file name %v with data %v: %w",
 						src, tmplData, err)
 				}
 				name = buf.String()
 			}
-			if err := copyFile(src, filepath.Join(tgtDir, name), tmplData); err != nil {
+			if err := copyFile(src, filepath.Join(tgtDir, name), tmplData, cfg); err != nil {
 				return err
 			}
 		}
@@ -133,47 +164,109 @@ func CopyDir2(src string, dst string, rename RenameFn, tmplData TemplateData) er
 	return nil
 }
 
-func copyFile(srcPath string, dstPath string, tmplData TemplateData) error {
+func copyFile(srcPath string, dstPath string, tmplData TemplateData, cfg *copyConfig) error {
+	start := time.Now()
+	n, err := copyFileContents(srcPath, dstPath, tmplData, cfg)
+	if err != nil {
+		return err
+	}
+	m := cfg.getMetrics()
+	m.Add(MetricFilesCopied, 1)
+	m.Add(MetricBytesCopied, n)
+	m.Observe(MetricFileLatency, time.Since(start))
+	return nil
+}
+
+// copyFileContents returns the number of bytes written to `dstPath`.
+func copyFileContents(
+	srcPath string,
+	dstPath string,
+	tmplData TemplateData,
+	cfg *copyConfig,
+) (int64, error) {
 	srcFile, err := os.Open(srcPath)
 	if err != nil {
-		return fmt.Errorf("opening src file: %w", err)
+		return 0, fmt.Errorf("opening src file: %w", err)
 	}
 	defer srcFile.Close()
 
 	// We want an error if the file already exists
 	dstFile, err := os.OpenFile(dstPath, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0660)
 	if err != nil {
-		return fmt.Errorf("creating dst file: %w", err)
+		return 0, fmt.Errorf("creating dst file: %w", err)
 	}
 	defer dstFile.Close()
 
 	if len(tmplData) == 0 {
-		_, err = io.Copy(dstFile, srcFile)
-		return err
+		return io.Copy(dstFile, srcFile)
 	}
-	buf, err := ioutil.ReadAll(srcFile)
+	fi, err := srcFile.Stat()
 	if err != nil {
-		return err
+		return 0, err
 	}
-	tmpl, err := template.New(path.Base(srcPath)).Parse(string(buf))
+	absPath, err := filepath.Abs(srcPath)
 	if err != nil {
-		return fmt.Errorf("parsing template %v: %w", srcPath, err)
+		return 0, fmt.Errorf("template path: %w", err)
 	}
-	tmpl.Option("missingkey=error")
-	if err := tmpl.Execute(dstFile, tmplData); err != nil {
-		return fmt.Errorf("executing template %v with data %v: %w", srcPath, tmplData, err)
+	key := fileKey{
+		path:        absPath,
+		modTime:     fi.ModTime(),
+		size:        fi.Size(),
+		actionLines: cfg.trimActionLines,
+	}
+	var readErr error
+	tmpl, err := cfg.cache.fileTemplate(key, func() (*template.Template, error) {
+		buf, err := ioutil.ReadAll(srcFile)
+		if err != nil {
+			readErr = err
+			return nil, err
+		}
+		text := string(buf)
+		if cfg.trimActionLines {
+			text = markActionLines(text)
+		}
+		tmpl, err := template.New(path.Base(srcPath)).Parse(text)
+		if err != nil {
+			return nil, err
+		}
+		return tmpl.Option("missingkey=error"), nil
+	})
+	if readErr != nil {
+		return 0, fmt.Errorf("reading template %v: %w", srcPath, readErr)
 	}
-	return nil
-}
-
-// Tree uses t.Log to print the output of the tree -a utility
-func Tree(t *testing.T, dir string) {
-	t.Helper()
-	out, err := exec.Command("tree", "-a", dir).Output()
 	if err != nil {
-		t.Fatal("Tree:", err)
+		cfg.getMetrics().Add(MetricTemplateFailures, 1)
+		return 0, fmt.Errorf("parsing template %v: %w", srcPath, err)
+	}
+	if !cfg.wantsWhitespace() {
+		cw := &countingWriter{w: dstFile}
+		if err := tmpl.Execute(cw, tmplData); err != nil {
+			cfg.getMetrics().Add(MetricTemplateFailures, 1)
+			return cw.n, fmt.Errorf("executing template %v with data %v: %w",
+				srcPath, tmplData, err)
+		}
+		return cw.n, nil
+	}
+	// Whitespace handling needs the whole rendered output.
+	rendered := &bytes.Buffer{}
+	if err := tmpl.Execute(rendered, tmplData); err != nil {
+		cfg.getMetrics().Add(MetricTemplateFailures, 1)
+		return 0, fmt.Errorf("executing template %v with data %v: %w", srcPath, tmplData, err)
 	}
-	t.Logf("\n%s\n", string(out))
+	n, err := dstFile.Write(cfg.fixWhitespace(rendered.Bytes()))
+	return int64(n), err
+}
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
 }
 
 // Chdir calls os.Chdir(dir) for the test to use. The directory is restored to the
@@ -0,0 +1,159 @@
+package utili
+
+import (
+	"expvar"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Names of the metrics reported by CopyDir2 and friends.
+const (
+	MetricFilesCopied      = "files_copied"
+	MetricBytesCopied      = "bytes_copied"
+	MetricTemplateFailures = "template_failures"
+	MetricFileLatency      = "file_latency_seconds"
+)
+
+// Metrics is the minimal interface used to report counters and histograms.
+// Implement it to forward the metrics to another system (eg: Prometheus) and pass it
+// to WithMetrics, or install it for the whole process with SetMetrics.
+type Metrics interface {
+	// Add adds `delta` to the counter `name`.
+	Add(name string, delta int64)
+	// Observe records the duration `d` in the histogram `name`.
+	Observe(name string, d time.Duration)
+}
+
+// DefaultExpvarName is the expvar name of the default metrics.
+const DefaultExpvarName = "utili"
+
+var (
+	metricsMu   sync.Mutex
+	metrics     Metrics
+	defaultOnce sync.Once
+)
+
+// WithMetrics makes the copy report to `m` instead of the package metrics (see
+// SetMetrics). If `m` is nil, metrics are discarded.
+func WithMetrics(m Metrics) Option {
+	return func(cfg *copyConfig) {
+		if m == nil {
+			m = nopMetrics{}
+		}
+		cfg.metrics = m
+	}
+}
+
+// SetMetrics replaces the package metrics, used by the copies without WithMetrics,
+// with `m`. If `m` is nil, metrics are discarded.
+//
+// If SetMetrics is not called, the first copy creates the default, an ExpvarMetrics
+// published as DefaultExpvarName. If that expvar name is already in use, for example
+// by the program itself, the default discards the metrics instead.
+func SetMetrics(m Metrics) {
+	if m == nil {
+		m = nopMetrics{}
+	}
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	metrics = m
+}
+
+func getMetrics() Metrics {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	if metrics == nil {
+		defaultOnce.Do(func() { metrics = newDefaultMetrics(DefaultExpvarName) })
+	}
+	return metrics
+}
+
+// newDefaultMetrics returns an ExpvarMetrics published as `name` or, if `name` is
+// already in use, a Metrics that discards everything.
+func newDefaultMetrics(name string) Metrics {
+	if expvar.Get(name) != nil {
+		return nopMetrics{}
+	}
+	return NewExpvarMetrics(name)
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) Add(string, int64)             {}
+func (nopMetrics) Observe(string, time.Duration) {}
+
+// ExpvarMetrics implements Metrics on top of the standard library expvar package.
+// Counters are expvar.Int; histograms are an expvar.Map with cumulative buckets
+// ("le_<seconds>" and "le_inf"), "count" and "sum".
+// Since this package imports expvar, the /debug/vars handler is registered on
+// http.DefaultServeMux, as with any importer of expvar.
+type ExpvarMetrics struct {
+	root *expvar.Map
+
+	mu         sync.Mutex
+	histograms map[string]*expvarHistogram
+}
+
+// NewExpvarMetrics returns an ExpvarMetrics published as the expvar `name`.
+// Like expvar.Publish, it panics if `name` is already in use; in particular, after the
+// package default has been created, for DefaultExpvarName.
+// To use a custom name for the package metrics, pass the result to SetMetrics.
+func NewExpvarMetrics(name string) *ExpvarMetrics {
+	return &ExpvarMetrics{
+		root:       expvar.NewMap(name),
+		histograms: map[string]*expvarHistogram{},
+	}
+}
+
+// Add adds `delta` to the counter `name`, creating it if needed.
+func (m *ExpvarMetrics) Add(name string, delta int64) {
+	m.root.Add(name, delta)
+}
+
+// Observe records the duration `d` in the histogram `name`, creating it if needed.
+func (m *ExpvarMetrics) Observe(name string, d time.Duration) {
+	m.mu.Lock()
+	h, ok := m.histograms[name]
+	if !ok {
+		h = newExpvarHistogram()
+		m.histograms[name] = h
+		m.root.Set(name, h.vars)
+	}
+	m.mu.Unlock()
+	h.observe(d)
+}
+
+// Upper bounds, in seconds, of the histogram buckets.
+var histogramBuckets = []float64{0.0001, 0.001, 0.01, 0.1, 1, 10}
+
+type expvarHistogram struct {
+	vars *expvar.Map
+}
+
+func newExpvarHistogram() *expvarHistogram {
+	vars := new(expvar.Map).Init()
+	for _, b := range histogramBuckets {
+		vars.Add(bucketName(b), 0)
+	}
+	vars.Add("le_inf", 0)
+	vars.Add("count", 0)
+	vars.AddFloat("sum", 0)
+	return &expvarHistogram{vars: vars}
+}
+
+func (h *expvarHistogram) observe(d time.Duration) {
+	secs := d.Seconds()
+	for _, b := range histogramBuckets {
+		if secs <= b {
+			h.vars.Add(bucketName(b), 1)
+		}
+	}
+	h.vars.Add("le_inf", 1)
+	h.vars.Add("count", 1)
+	h.vars.AddFloat("sum", secs)
+}
+
+func bucketName(b float64) string {
+	return "le_" + strconv.FormatFloat(b, 'g', -1, 64)
+}
@@ -0,0 +1,163 @@
+package utili
+
+import (
+	"expvar"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeMetrics struct {
+	mu           sync.Mutex
+	counters     map[string]int64
+	observations map[string]int
+}
+
+func newFakeMetrics() *fakeMetrics {
+	return &fakeMetrics{counters: map[string]int64{}, observations: map[string]int{}}
+}
+
+func (m *fakeMetrics) Add(name string, delta int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counters[name] += delta
+}
+
+func (m *fakeMetrics) Observe(name string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.observations[name]++
+}
+
+// writeTree creates below `dir` the files in `files`, a map of slash-separated path
+// to contents.
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, contents := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0770); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(contents), 0660); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestWithMetricsCountsCopies(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "src")
+	writeTree(t, src, map[string]string{
+		"a.template":     "hello {{.who}}",
+		"sub/b.template": "bye",
+	})
+	m := newFakeMetrics()
+
+	err := CopyDir2(src, t.TempDir(), IdentityRename, TemplateData{"who": "joe"},
+		WithMetrics(m))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if have, want := m.counters[MetricFilesCopied], int64(2); have != want {
+		t.Errorf("files copied: have %d; want %d", have, want)
+	}
+	if have, want := m.counters[MetricBytesCopied], int64(len("hello joe")+len("bye")); have != want {
+		t.Errorf("bytes copied: have %d; want %d", have, want)
+	}
+	if have, want := m.counters[MetricTemplateFailures], int64(0); have != want {
+		t.Errorf("template failures: have %d; want %d", have, want)
+	}
+	if have, want := m.observations[MetricFileLatency], 2; have != want {
+		t.Errorf("latency observations: have %d; want %d", have, want)
+	}
+}
+
+func TestWithMetricsCountsTemplateFailures(t *testing.T) {
+	testCases := []struct {
+		name  string
+		files map[string]string
+	}{
+		{"parse contents", map[string]string{"a.template": "{{.who"}},
+		{"execute contents", map[string]string{"a.template": "{{.missing}}"}},
+		{"parse name", map[string]string{"{{.who.template": ""}},
+		{"execute name", map[string]string{"{{.missing}}.template": ""}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			src := filepath.Join(t.TempDir(), "src")
+			writeTree(t, src, tc.files)
+			m := newFakeMetrics()
+
+			err := CopyDir2(src, t.TempDir(), IdentityRename, TemplateData{"who": "joe"},
+				WithMetrics(m))
+			if err == nil {
+				t.Fatal("have: no error; want: error")
+			}
+
+			if have, want := m.counters[MetricTemplateFailures], int64(1); have != want {
+				t.Errorf("template failures: have %d; want %d", have, want)
+			}
+			if have, want := m.counters[MetricFilesCopied], int64(0); have != want {
+				t.Errorf("files copied: have %d; want %d", have, want)
+			}
+		})
+	}
+}
+
+func TestExpvarMetrics(t *testing.T) {
+	m := NewExpvarMetrics("utili-test")
+
+	m.Add("n", 2)
+	m.Add("n", 3)
+	m.Observe("h", 5*time.Millisecond)
+	m.Observe("h", 5*time.Second)
+
+	if have, want := m.root.Get("n").String(), "5"; have != want {
+		t.Errorf("counter: have %s; want %s", have, want)
+	}
+	h := m.histograms["h"].vars
+	for _, tc := range []struct {
+		bucket string
+		want   string
+	}{
+		{"le_0.001", "0"},
+		{"le_0.01", "1"},
+		{"le_10", "2"},
+		{"le_inf", "2"},
+		{"count", "2"},
+	} {
+		if have := h.Get(tc.bucket).String(); have != tc.want {
+			t.Errorf("bucket %s: have %s; want %s", tc.bucket, have, tc.want)
+		}
+	}
+}
+
+func TestNewDefaultMetrics(t *testing.T) {
+	testCases := []struct {
+		name      string
+		published bool
+		wantNop   bool
+	}{
+		{"name free", false, false},
+		{"name in use", true, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			name := "utili-default-test-" + t.Name()
+			if tc.published {
+				expvar.NewString(name)
+			}
+
+			// Must not panic.
+			m := newDefaultMetrics(name)
+
+			if _, isNop := m.(nopMetrics); isNop != tc.wantNop {
+				t.Errorf("have: %T; want nop: %v", m, tc.wantNop)
+			}
+		})
+	}
+}
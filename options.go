@@ -0,0 +1,179 @@
+package utili
+
+import (
+	"bytes"
+	"os"
+	"regexp"
+)
+
+// Option configures a copy made by CopyDir, CopyDir2 or a Copier (see NewCopier).
+// Options select the entries to copy (WithFilter), how templates are rendered (eg:
+// TrimTrailingSpace) and cached (WithTemplateCache), and where metrics are reported
+// (WithMetrics).
+type Option func(*copyConfig)
+
+type copyConfig struct {
+	trimTrailingSpace     bool
+	singleTrailingNewline bool
+	collapseBlankLines    bool
+	trimActionLines       bool
+	cache                 *TemplateCache
+	filters               []FilterFn
+	metrics               Metrics
+}
+
+func newCopyConfig(opts []Option) *copyConfig {
+	cfg := &copyConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// FilterFn reports whether the file or directory at `path` in the source tree should
+// be copied. `path` is relative to the source directory given to the copy, with "/"
+// as separator, eg "sub/skip.txt" when copying "testdata/foo/sub/skip.txt" from
+// "testdata/foo".
+type FilterFn func(path string, fi os.FileInfo) bool
+
+// WithFilter skips the entries of the source tree for which `filter` returns false.
+// A skipped directory is not descended into. It can be given multiple times; an entry
+// is copied only if all filters accept it.
+func WithFilter(filter FilterFn) Option {
+	return func(cfg *copyConfig) { cfg.filters = append(cfg.filters, filter) }
+}
+
+// getMetrics returns the metrics given with WithMetrics, or the package metrics.
+func (cfg *copyConfig) getMetrics() Metrics {
+	if cfg.metrics != nil {
+		return cfg.metrics
+	}
+	return getMetrics()
+}
+
+func (cfg *copyConfig) accept(path string, fi os.FileInfo) bool {
+	for _, filter := range cfg.filters {
+		if !filter(path, fi) {
+			return false
+		}
+	}
+	return true
+}
+
+// TrimTrailingSpace removes spaces and tabs at the end of each line of the rendered
+// templates. Line endings, "\n" or "\r\n", are preserved.
+func TrimTrailingSpace() Option {
+	return func(cfg *copyConfig) { cfg.trimTrailingSpace = true }
+}
+
+// SingleTrailingNewline makes each rendered template end with exactly one line
+// ending, by removing the extra empty lines at the end or by adding a "\n" if
+// missing. A final "\r\n" is preserved. The rest of the last line is untouched.
+func SingleTrailingNewline() Option {
+	return func(cfg *copyConfig) { cfg.singleTrailingNewline = true }
+}
+
+// CollapseBlankLines replaces each run of blank lines (empty or only whitespace) of
+// the rendered templates with the first line of the run.
+func CollapseBlankLines() Option {
+	return func(cfg *copyConfig) { cfg.collapseBlankLines = true }
+}
+
+// TrimActionLines removes from the rendered templates the lines that, in the
+// template, contain only actions (eg: `{{if .x}}` or `{{end}}`) and whitespace, and
+// that rendered as only whitespace. For example, with x=1, the template
+//
+//	a
+//	{{if .x}}
+//	b
+//	{{end}}
+//	c
+//
+// renders as "a\nb\nc\n" instead of "a\n\nb\n\nc\n". An action-only line that
+// renders some text, such as `{{.x}}`, is kept. Actions spanning multiple lines are
+// not recognized.
+func TrimActionLines() Option {
+	return func(cfg *copyConfig) { cfg.trimActionLines = true }
+}
+
+func (cfg *copyConfig) wantsWhitespace() bool {
+	return cfg.trimTrailingSpace || cfg.singleTrailingNewline || cfg.collapseBlankLines ||
+		cfg.trimActionLines
+}
+
+// actionLineMarker is appended by markActionLines to the action-only lines of a
+// template. It is a sequence of Unicode private use characters, not expected in the
+// template text.
+const actionLineMarker = "\uE000utili\uE000"
+
+var actionLineRx = regexp.MustCompile(`(?m)^[ \t]*(?:\{\{.*?\}\}[ \t]*)+(\r?)$`)
+
+// markActionLines returns the template source `text` with actionLineMarker at the
+// end of each line containing only actions, before the line ending.
+func markActionLines(text string) string {
+	return actionLineRx.ReplaceAllString(text, "${0}"+actionLineMarker)
+}
+
+// fixWhitespace returns a copy of the rendered `text` with the whitespace options
+// of `cfg` applied.
+func (cfg *copyConfig) fixWhitespace(text []byte) []byte {
+	lines := bytes.Split(text, []byte("\n"))
+	out := make([][]byte, 0, len(lines))
+	prevBlank := false
+	for i, line := range lines {
+		// The last element is what follows the final newline, not a line.
+		last := i == len(lines)-1
+		if cfg.trimActionLines {
+			if marked := bytes.Replace(line, []byte(actionLineMarker), nil, -1); len(marked) != len(line) {
+				line = marked
+				if len(bytes.TrimSpace(line)) == 0 {
+					if last {
+						out = append(out, nil)
+					}
+					continue
+				}
+			}
+		}
+		if cfg.trimTrailingSpace {
+			line = trimTrailingSpace(line)
+		}
+		blank := len(bytes.TrimSpace(line)) == 0
+		if cfg.collapseBlankLines && blank && !last && prevBlank {
+			continue
+		}
+		prevBlank = blank && !last
+		out = append(out, line)
+	}
+	result := bytes.Join(out, []byte("\n"))
+
+	if cfg.singleTrailingNewline {
+		result = singleTrailingNewline(result)
+	}
+	return result
+}
+
+// trimTrailingSpace returns `line` without the trailing spaces and tabs, keeping a
+// final "\r".
+func trimTrailingSpace(line []byte) []byte {
+	if bytes.HasSuffix(line, []byte("\r")) {
+		return append(bytes.TrimRight(line[:len(line)-1], " \t"), '\r')
+	}
+	return bytes.TrimRight(line, " \t")
+}
+
+// singleTrailingNewline returns `text` ending with exactly one "\n" or "\r\n".
+func singleTrailingNewline(text []byte) []byte {
+	eol := []byte("\n")
+	if bytes.HasSuffix(text, []byte("\r\n")) {
+		eol = []byte("\r\n")
+	}
+	for {
+		if bytes.HasSuffix(text, []byte("\r\n")) {
+			text = text[:len(text)-2]
+		} else if bytes.HasSuffix(text, []byte("\n")) {
+			text = text[:len(text)-1]
+		} else {
+			return append(text, eol...)
+		}
+	}
+}
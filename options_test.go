@@ -0,0 +1,121 @@
+package utili
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFixWhitespace(t *testing.T) {
+	testCases := []struct {
+		name string
+		opts []Option
+		text string
+		want string
+	}{
+		{"no options", nil, "a  \n\n\nb", "a  \n\n\nb"},
+		{"trim: spaces and tabs", []Option{TrimTrailingSpace()}, "a \t\nb  ", "a\nb"},
+		{"trim: keeps crlf", []Option{TrimTrailingSpace()}, "a  \r\nc\r\n", "a\r\nc\r\n"},
+		{"trim: whitespace-only line", []Option{TrimTrailingSpace()}, "a\n \t\nb\n", "a\n\nb\n"},
+		{"single nl: adds missing", []Option{SingleTrailingNewline()}, "a", "a\n"},
+		{"single nl: removes extra", []Option{SingleTrailingNewline()}, "a\n\n\n", "a\n"},
+		{"single nl: keeps crlf", []Option{SingleTrailingNewline()}, "a\r\n\r\n", "a\r\n"},
+		{"single nl: keeps trailing space", []Option{SingleTrailingNewline()}, "a  \n\n", "a  \n"},
+		{"single nl: empty output", []Option{SingleTrailingNewline()}, "", "\n"},
+		{"collapse: runs", []Option{CollapseBlankLines()}, "a\n\n\n\nb\n\nc\n", "a\n\nb\n\nc\n"},
+		{"collapse: whitespace-only lines", []Option{CollapseBlankLines()}, "a\n  \n\t\nb", "a\n  \nb"},
+		{"collapse: final element", []Option{CollapseBlankLines()}, "a\n\n", "a\n\n"},
+		{"collapse: crlf", []Option{CollapseBlankLines()}, "a\r\n\r\n\r\nb\r\n", "a\r\n\r\nb\r\n"},
+		{
+			"all",
+			[]Option{TrimTrailingSpace(), SingleTrailingNewline(), CollapseBlankLines()},
+			"a \n \n\n\nb\t\n\n",
+			"a\n\nb\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := newCopyConfig(tc.opts)
+
+			have := string(cfg.fixWhitespace([]byte(tc.text)))
+
+			if have != tc.want {
+				t.Errorf("\nhave: %q\nwant: %q", have, tc.want)
+			}
+		})
+	}
+}
+
+func TestTrimActionLines(t *testing.T) {
+	testCases := []struct {
+		name string
+		tmpl string
+		data TemplateData
+		want string
+	}{
+		{
+			name: "if true",
+			tmpl: "a\n{{if .x}}\nb\n{{end}}\nc\n",
+			data: TemplateData{"x": "1"},
+			want: "a\nb\nc\n",
+		},
+		{
+			name: "if false",
+			tmpl: "a\n{{if .y}}\nb\n{{end}}\nc\n",
+			data: TemplateData{"y": ""},
+			want: "a\nc\n",
+		},
+		{
+			name: "indented actions, crlf",
+			tmpl: "a:\r\n  {{if .x}}\r\n  b: 1\r\n  {{end}}\r\nc: 2\r\n",
+			data: TemplateData{"x": "1"},
+			want: "a:\r\n  b: 1\r\nc: 2\r\n",
+		},
+		{
+			name: "action rendering text is kept",
+			tmpl: "a\n{{.x}}\nb\n",
+			data: TemplateData{"x": "1"},
+			want: "a\n1\nb\n",
+		},
+		{
+			name: "action-only last line without newline",
+			tmpl: "{{if .x}}\na\n{{end}}",
+			data: TemplateData{"x": "1"},
+			want: "a\n",
+		},
+		{
+			name: "blank lines of the template are kept",
+			tmpl: "a\n\n{{if .x}}\nb\n{{end}}\n",
+			data: TemplateData{"x": "1"},
+			want: "a\n\nb\n",
+		},
+		{
+			name: "mixed text and action",
+			tmpl: "a{{if .x}}\nb\n{{end}}\n",
+			data: TemplateData{"x": "1"},
+			want: "a\nb\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			src := filepath.Join(t.TempDir(), "src")
+			writeTree(t, src, map[string]string{"f.template": tc.tmpl})
+			dst := t.TempDir()
+
+			err := CopyDir2(src, dst, IdentityRename, tc.data, TrimActionLines())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			have, err := os.ReadFile(filepath.Join(dst, "src", "f"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(have) != tc.want {
+				t.Errorf("\nhave: %q\nwant: %q", have, tc.want)
+			}
+		})
+	}
+}
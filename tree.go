@@ -0,0 +1,142 @@
+package utili
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// Tree uses t.Log to print the output of the tree -a utility
+func Tree(t *testing.T, dir string) {
+	t.Helper()
+	out, err := exec.Command("tree", "-a", dir).Output()
+	if err != nil {
+		t.Fatal("Tree:", err)
+	}
+	t.Logf("\n%s\n", string(out))
+}
+
+// TreeEntry describes a file or directory in the listing returned by ListTree.
+type TreeEntry struct {
+	// Path relative to the listed directory, with "/" as separator.
+	Path string `json:"path"`
+	// One of "file", "dir", "symlink" or "other".
+	Type string `json:"type"`
+	// Always 0 for directories, whose size depends on the filesystem.
+	Size int64 `json:"size"`
+	// As returned by fs.FileMode.String(), eg "-rw-r--r--". The permissions depend
+	// on how the entry was created, in particular on the umask.
+	Mode string `json:"mode"`
+	// "sha256:" followed by the hex digest of the contents. Only for regular files.
+	Hash string `json:"hash,omitempty"`
+}
+
+// ListTree returns the entries below `dir`, in lexical order, `dir` itself excluded.
+// If `dir` is a symlink to a directory, it lists the target directory. Symlinks below
+// `dir` are listed but not followed.
+// It is the machine-readable counterpart of Tree.
+func ListTree(dir string) ([]TreeEntry, error) {
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return nil, fmt.Errorf("%v is not a directory", dir)
+	}
+	entries := []TreeEntry{}
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == root {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		entry := TreeEntry{
+			Path: filepath.ToSlash(rel),
+			Type: entryType(fi.Mode()),
+			Mode: fi.Mode().String(),
+		}
+		if !fi.IsDir() {
+			entry.Size = fi.Size()
+		}
+		if fi.Mode().IsRegular() {
+			if entry.Hash, err = hashFile(path); err != nil {
+				return err
+			}
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing tree %v: %w", dir, err)
+	}
+	return entries, nil
+}
+
+// WriteTreeJSON writes to `w` the entries returned by ListTree, as a JSON array.
+func WriteTreeJSON(w io.Writer, dir string) error {
+	entries, err := ListTree(dir)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(entries)
+}
+
+// TreeJSON is like Tree, but uses t.Log to print the JSON listing of WriteTreeJSON.
+// It does not depend on the tree utility.
+func TreeJSON(t *testing.T, dir string) {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	if err := WriteTreeJSON(buf, dir); err != nil {
+		t.Fatal("TreeJSON:", err)
+	}
+	t.Logf("\n%s\n", buf.String())
+}
+
+func entryType(mode fs.FileMode) string {
+	switch {
+	case mode.IsRegular():
+		return "file"
+	case mode.IsDir():
+		return "dir"
+	case mode&fs.ModeSymlink != 0:
+		return "symlink"
+	default:
+		return "other"
+	}
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,126 @@
+package utili
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestListTree(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"a":     "hello",
+		"sub/b": "",
+	})
+	if err := os.Symlink("a", filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("sub", filepath.Join(dir, "sublink")); err != nil {
+		t.Fatal(err)
+	}
+
+	rootLink := filepath.Join(t.TempDir(), "root-link")
+	if err := os.Symlink(dir, rootLink); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		path string
+		typ  string
+		size int64
+		hash string
+	}{
+		{"a", "file", 5, "sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"},
+		{"link", "symlink", 1, ""},
+		{"sub", "dir", 0, ""},
+		{"sub/b", "file", 0, "sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+		// A symlink to a directory is not followed.
+		{"sublink", "symlink", 3, ""},
+	}
+	testCases := []struct {
+		name string
+		root string
+	}{
+		{"directory", dir},
+		// Lists the target directory, as for a directory.
+		{"symlink to directory", rootLink},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			have, err := ListTree(tc.root)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(have) != len(want) {
+				t.Fatalf("\nhave: %+v\nwant: %+v", have, want)
+			}
+			for i, w := range want {
+				h := have[i]
+				if h.Path != w.path || h.Type != w.typ || h.Size != w.size || h.Hash != w.hash {
+					t.Errorf("entry %d:\nhave: %+v\nwant: %+v", i, h, w)
+				}
+			}
+		})
+	}
+}
+
+func TestListTreeFailure(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"file": ""})
+	fileLink := filepath.Join(dir, "file-link")
+	if err := os.Symlink("file", fileLink); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name    string
+		root    string
+		wantErr string
+	}{
+		{"not a directory", filepath.Join(dir, "file"), "is not a directory"},
+		{"symlink to file", fileLink, "is not a directory"},
+		{"missing", filepath.Join(dir, "missing"), "no such file or directory"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ListTree(tc.root)
+
+			if err == nil {
+				t.Fatalf("have: no error; want: %q", tc.wantErr)
+			}
+			if !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("have: %q; want: %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestWriteTreeJSON(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"sub/a": "x"})
+	buf := &bytes.Buffer{}
+
+	if err := WriteTreeJSON(buf, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	var have []map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &have); err != nil {
+		t.Fatal(err)
+	}
+	if len(have) != 2 {
+		t.Fatalf("have %d entries; want 2:\n%s", len(have), buf.String())
+	}
+	if _, ok := have[0]["hash"]; ok {
+		t.Errorf("dir entry: have hash; want none: %v", have[0])
+	}
+	if have, want := have[1]["path"], "sub/a"; have != want {
+		t.Errorf("path: have %v; want %v", have, want)
+	}
+}